@@ -0,0 +1,353 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package externalaccount
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/auth/internal"
+)
+
+const (
+	defaultAWSRegionURL              = "http://169.254.169.254/latest/meta-data/placement/availability-zone"
+	defaultAWSIMDSv2SessionTokenURL  = "http://169.254.169.254/latest/api/token"
+	defaultAWSSecurityCredentialsURL = "http://169.254.169.254/latest/meta-data/iam/security-credentials"
+
+	awsSigningAlgorithm = "AWS4-HMAC-SHA256"
+)
+
+// imdsTimeout bounds each individual IMDSv2 metadata request. The metadata
+// service is local to the instance, so a slow or unreachable response
+// should fail fast rather than block on the caller's context or the
+// client's (often unbounded) timeout.
+const imdsTimeout = 2 * time.Second
+
+// AWSSource obtains a subject token by signing an AWS STS GetCallerIdentity
+// request with credentials discovered from the EC2/ECS/EKS instance
+// metadata service (IMDSv2) or the environment, following Google's AWS
+// workload identity federation flow. The signed request, not the caller
+// identity response itself, becomes the subject token that is presented to
+// Google's Security Token Service.
+type AWSSource struct {
+	// Region overrides the region otherwise discovered from the IMDSv2
+	// metadata server. Optional.
+	Region string
+	// AccessKeyID, SecretAccessKey, and SessionToken override the
+	// credentials otherwise discovered from the AWS_ACCESS_KEY_ID /
+	// AWS_SECRET_ACCESS_KEY / AWS_SESSION_TOKEN environment variables or,
+	// failing that, IMDSv2. Optional.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// IMDSv2SessionTokenURL, RegionURL, and SecurityCredentialsURL override
+	// the IMDSv2 endpoints used to discover the session token, region, and
+	// role credentials respectively. Optional.
+	IMDSv2SessionTokenURL  string
+	RegionURL              string
+	SecurityCredentialsURL string
+}
+
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Region          string
+}
+
+// subjectTokenFromAWS signs an STS GetCallerIdentity request and serializes
+// it into the JSON structure Google's Security Token Service expects as an
+// AWS subject token.
+func subjectTokenFromAWS(ctx context.Context, client *http.Client, src *AWSSource, audience string) (string, error) {
+	creds, err := awsCredentialsFor(ctx, client, src)
+	if err != nil {
+		return "", err
+	}
+
+	host := fmt.Sprintf("sts.%s.amazonaws.com", creds.Region)
+	reqURL := fmt.Sprintf("https://%s/?Action=GetCallerIdentity&Version=2011-06-15", host)
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	dateStamp := now.Format("20060102")
+
+	headers := map[string]string{
+		"host":                         host,
+		"x-amz-date":                   amzDate,
+		"x-goog-cloud-target-resource": audience,
+	}
+	if creds.SessionToken != "" {
+		headers["x-amz-security-token"] = creds.SessionToken
+	}
+	signedHeaders, canonicalHeaders := canonicalizeAWSHeaders(headers)
+
+	canonicalRequest := strings.Join([]string{
+		"POST",
+		"/",
+		"Action=GetCallerIdentity&Version=2011-06-15",
+		canonicalHeaders,
+		signedHeaders,
+		hashHex(nil),
+	}, "\n")
+
+	credentialScope := fmt.Sprintf("%s/%s/sts/aws4_request", dateStamp, creds.Region)
+	stringToSign := strings.Join([]string{
+		awsSigningAlgorithm,
+		amzDate,
+		credentialScope,
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := awsSigningKey(creds.SecretAccessKey, dateStamp, creds.Region)
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+	authorization := fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		awsSigningAlgorithm, creds.AccessKeyID, credentialScope, signedHeaders, signature)
+
+	type awsHeader struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}
+	reqHeaders := []awsHeader{
+		{Key: "Authorization", Value: authorization},
+		{Key: "host", Value: host},
+		{Key: "x-amz-date", Value: amzDate},
+	}
+	if creds.SessionToken != "" {
+		reqHeaders = append(reqHeaders, awsHeader{Key: "x-amz-security-token", Value: creds.SessionToken})
+	}
+	// x-goog-cloud-target-resource tells Google's STS which resource the
+	// signed request is being presented for. It is included in SignedHeaders
+	// above so the binding to this audience is covered by the AWS signature,
+	// preventing the subject token from being replayed against a different
+	// workload identity pool or provider.
+	reqHeaders = append(reqHeaders, awsHeader{Key: "x-goog-cloud-target-resource", Value: audience})
+
+	subjectToken := struct {
+		URL     string      `json:"url"`
+		Method  string      `json:"method"`
+		Headers []awsHeader `json:"headers"`
+	}{
+		URL:     reqURL,
+		Method:  "POST",
+		Headers: reqHeaders,
+	}
+	tokenJSON, err := json.Marshal(subjectToken)
+	if err != nil {
+		return "", fmt.Errorf("externalaccount: unable to marshal AWS subject token: %w", err)
+	}
+	return string(tokenJSON), nil
+}
+
+func canonicalizeAWSHeaders(headers map[string]string) (signedHeaders, canonicalHeaders string) {
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	for _, k := range names {
+		sb.WriteString(k)
+		sb.WriteString(":")
+		sb.WriteString(strings.TrimSpace(headers[k]))
+		sb.WriteString("\n")
+	}
+	return strings.Join(names, ";"), sb.String()
+}
+
+func hashHex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func awsSigningKey(secret, dateStamp, region string) []byte {
+	kDate := hmacSHA256([]byte("AWS4"+secret), dateStamp)
+	kRegion := hmacSHA256(kDate, region)
+	kService := hmacSHA256(kRegion, "sts")
+	return hmacSHA256(kService, "aws4_request")
+}
+
+// awsCredentialsFor resolves AWS credentials and region, preferring
+// explicit AWSSource fields, then the standard AWS environment variables,
+// then IMDSv2.
+func awsCredentialsFor(ctx context.Context, client *http.Client, src *AWSSource) (*awsCredentials, error) {
+	accessKeyID, secretAccessKey, sessionToken := src.AccessKeyID, src.SecretAccessKey, src.SessionToken
+	if accessKeyID == "" {
+		accessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if secretAccessKey == "" {
+		secretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if sessionToken == "" {
+		sessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	region := src.Region
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+
+	if accessKeyID != "" && secretAccessKey != "" {
+		if region == "" {
+			imdsToken, err := imdsv2SessionToken(ctx, client, src)
+			if err != nil {
+				return nil, err
+			}
+			region, err = awsRegion(ctx, client, src, imdsToken)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return &awsCredentials{
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: secretAccessKey,
+			SessionToken:    sessionToken,
+			Region:          region,
+		}, nil
+	}
+	return awsCredentialsFromIMDSv2(ctx, client, src)
+}
+
+func imdsv2SessionToken(ctx context.Context, client *http.Client, src *AWSSource) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, imdsTimeout)
+	defer cancel()
+
+	tokenURL := src.IMDSv2SessionTokenURL
+	if tokenURL == "" {
+		tokenURL = defaultAWSIMDSv2SessionTokenURL
+	}
+	req, err := http.NewRequestWithContext(ctx, "PUT", tokenURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("externalaccount: unable to create IMDSv2 token request: %w", err)
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "300")
+	resp, body, err := internal.DoRequest(client, req)
+	if err != nil {
+		return "", fmt.Errorf("externalaccount: unable to fetch IMDSv2 session token: %w", err)
+	}
+	if c := resp.StatusCode; c < 200 || c > 299 {
+		return "", fmt.Errorf("externalaccount: status code %d fetching IMDSv2 session token: %s", c, body)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+func awsRegion(ctx context.Context, client *http.Client, src *AWSSource, imdsToken string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, imdsTimeout)
+	defer cancel()
+
+	regionURL := src.RegionURL
+	if regionURL == "" {
+		regionURL = defaultAWSRegionURL
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", regionURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("externalaccount: unable to create region request: %w", err)
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", imdsToken)
+	resp, body, err := internal.DoRequest(client, req)
+	if err != nil {
+		return "", fmt.Errorf("externalaccount: unable to fetch AWS region: %w", err)
+	}
+	if c := resp.StatusCode; c < 200 || c > 299 {
+		return "", fmt.Errorf("externalaccount: status code %d fetching AWS region: %s", c, body)
+	}
+	// The metadata server returns an availability zone (e.g. "us-east-1a");
+	// the region is that string with the trailing zone letter trimmed.
+	az := strings.TrimSpace(string(body))
+	if len(az) < 2 {
+		return "", errors.New("externalaccount: invalid AWS availability zone")
+	}
+	return az[:len(az)-1], nil
+}
+
+func awsCredentialsFromIMDSv2(ctx context.Context, client *http.Client, src *AWSSource) (*awsCredentials, error) {
+	token, err := imdsv2SessionToken(ctx, client, src)
+	if err != nil {
+		return nil, err
+	}
+	region, err := awsRegion(ctx, client, src, token)
+	if err != nil {
+		return nil, err
+	}
+
+	roleCtx, cancel := context.WithTimeout(ctx, imdsTimeout)
+	defer cancel()
+
+	credsURL := src.SecurityCredentialsURL
+	if credsURL == "" {
+		credsURL = defaultAWSSecurityCredentialsURL
+	}
+	roleReq, err := http.NewRequestWithContext(roleCtx, "GET", credsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("externalaccount: unable to create role request: %w", err)
+	}
+	roleReq.Header.Set("X-aws-ec2-metadata-token", token)
+	resp, body, err := internal.DoRequest(client, roleReq)
+	if err != nil {
+		return nil, fmt.Errorf("externalaccount: unable to fetch IAM role: %w", err)
+	}
+	if c := resp.StatusCode; c < 200 || c > 299 {
+		return nil, fmt.Errorf("externalaccount: status code %d fetching IAM role: %s", c, body)
+	}
+	role := strings.TrimSpace(string(body))
+	if role == "" {
+		return nil, errors.New("externalaccount: no IAM role attached to instance")
+	}
+
+	credCtx, cancel2 := context.WithTimeout(ctx, imdsTimeout)
+	defer cancel2()
+	credReq, err := http.NewRequestWithContext(credCtx, "GET", credsURL+"/"+role, nil)
+	if err != nil {
+		return nil, fmt.Errorf("externalaccount: unable to create credentials request: %w", err)
+	}
+	credReq.Header.Set("X-aws-ec2-metadata-token", token)
+	resp, body, err = internal.DoRequest(client, credReq)
+	if err != nil {
+		return nil, fmt.Errorf("externalaccount: unable to fetch role credentials: %w", err)
+	}
+	if c := resp.StatusCode; c < 200 || c > 299 {
+		return nil, fmt.Errorf("externalaccount: status code %d fetching role credentials: %s", c, body)
+	}
+	var parsed struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string `json:"SecretAccessKey"`
+		Token           string `json:"Token"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, fmt.Errorf("externalaccount: unable to parse role credentials: %w", err)
+	}
+	return &awsCredentials{
+		AccessKeyID:     parsed.AccessKeyID,
+		SecretAccessKey: parsed.SecretAccessKey,
+		SessionToken:    parsed.Token,
+		Region:          region,
+	}, nil
+}
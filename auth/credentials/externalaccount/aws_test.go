@@ -0,0 +1,145 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package externalaccount
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSubjectTokenFromAWS_ExplicitCredentials(t *testing.T) {
+	src := &AWSSource{
+		Region:          "us-east-1",
+		AccessKeyID:     "AKIAEXAMPLE",
+		SecretAccessKey: "secret",
+		SessionToken:    "session-token",
+	}
+	token, err := subjectTokenFromAWS(context.Background(), http.DefaultClient, src, "//iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/pool/providers/aws-provider")
+	if err != nil {
+		t.Fatalf("subjectTokenFromAWS: %v", err)
+	}
+
+	var parsed struct {
+		URL     string `json:"url"`
+		Method  string `json:"method"`
+		Headers []struct {
+			Key   string `json:"key"`
+			Value string `json:"value"`
+		} `json:"headers"`
+	}
+	if err := json.Unmarshal([]byte(token), &parsed); err != nil {
+		t.Fatalf("unmarshal subject token: %v", err)
+	}
+	if want := "https://sts.us-east-1.amazonaws.com/?Action=GetCallerIdentity&Version=2011-06-15"; parsed.URL != want {
+		t.Errorf("URL = %q, want %q", parsed.URL, want)
+	}
+	if parsed.Method != "POST" {
+		t.Errorf("Method = %q, want POST", parsed.Method)
+	}
+	headers := map[string]string{}
+	for _, h := range parsed.Headers {
+		headers[h.Key] = h.Value
+	}
+	authz, ok := headers["Authorization"]
+	if !ok {
+		t.Fatal("missing Authorization header")
+	}
+	if !strings.Contains(authz, "SignedHeaders=") || !strings.Contains(authz, "x-goog-cloud-target-resource") {
+		t.Errorf("Authorization = %q, want SignedHeaders to include x-goog-cloud-target-resource so the audience is covered by the AWS signature", authz)
+	}
+	if got, want := headers["x-amz-security-token"], "session-token"; got != want {
+		t.Errorf("x-amz-security-token = %q, want %q", got, want)
+	}
+	if got, want := headers["x-goog-cloud-target-resource"], "//iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/pool/providers/aws-provider"; got != want {
+		t.Errorf("x-goog-cloud-target-resource = %q, want %q", got, want)
+	}
+}
+
+func TestSubjectTokenFromAWS_IMDSv2Fallback(t *testing.T) {
+	imds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "PUT" && r.URL.Path == "/token":
+			w.Write([]byte("imds-token"))
+		case r.URL.Path == "/region":
+			if got := r.Header.Get("X-aws-ec2-metadata-token"); got != "imds-token" {
+				t.Errorf("region request token header = %q, want imds-token", got)
+			}
+			w.Write([]byte("us-west-2a"))
+		case r.URL.Path == "/creds":
+			w.Write([]byte("my-role"))
+		case r.URL.Path == "/creds/my-role":
+			json.NewEncoder(w).Encode(map[string]string{
+				"AccessKeyId":     "imds-access-key",
+				"SecretAccessKey": "imds-secret",
+				"Token":           "imds-session-token",
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer imds.Close()
+
+	src := &AWSSource{
+		IMDSv2SessionTokenURL:  imds.URL + "/token",
+		RegionURL:              imds.URL + "/region",
+		SecurityCredentialsURL: imds.URL + "/creds",
+	}
+	token, err := subjectTokenFromAWS(context.Background(), http.DefaultClient, src, "aud")
+	if err != nil {
+		t.Fatalf("subjectTokenFromAWS: %v", err)
+	}
+	var parsed struct {
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal([]byte(token), &parsed); err != nil {
+		t.Fatalf("unmarshal subject token: %v", err)
+	}
+	if want := "https://sts.us-west-2.amazonaws.com/?Action=GetCallerIdentity&Version=2011-06-15"; parsed.URL != want {
+		t.Errorf("URL = %q, want %q", parsed.URL, want)
+	}
+}
+
+func TestSubjectTokenFromAWS_IMDSv2Error(t *testing.T) {
+	imds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer imds.Close()
+
+	src := &AWSSource{
+		IMDSv2SessionTokenURL:  imds.URL,
+		RegionURL:              imds.URL,
+		SecurityCredentialsURL: imds.URL,
+	}
+	if _, err := subjectTokenFromAWS(context.Background(), http.DefaultClient, src, "aud"); err == nil {
+		t.Error("subjectTokenFromAWS: got nil error, want error")
+	}
+}
+
+func TestCanonicalizeAWSHeaders(t *testing.T) {
+	signedHeaders, canonicalHeaders := canonicalizeAWSHeaders(map[string]string{
+		"host":       "sts.us-east-1.amazonaws.com",
+		"x-amz-date": "20250101T000000Z",
+	})
+	if want := "host;x-amz-date"; signedHeaders != want {
+		t.Errorf("signedHeaders = %q, want %q", signedHeaders, want)
+	}
+	if want := "host:sts.us-east-1.amazonaws.com\nx-amz-date:20250101T000000Z\n"; canonicalHeaders != want {
+		t.Errorf("canonicalHeaders = %q, want %q", canonicalHeaders, want)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package externalaccount
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// allowExecutablesEnvVar gates running an arbitrary command to obtain a
+// subject token, consistent with Google's other external-account client
+// libraries: an operator must opt in explicitly.
+const allowExecutablesEnvVar = "GOOGLE_EXTERNAL_ACCOUNT_ALLOW_EXECUTABLES"
+
+// defaultExecutableTimeout is used when ExecutableSource.TimeoutMillis is
+// unset.
+const defaultExecutableTimeout = 30 * time.Second
+
+// ExecutableSource obtains a subject token by running a user-provided
+// command and parsing a JSON response from its stdout. The command is only
+// run if GOOGLE_EXTERNAL_ACCOUNT_ALLOW_EXECUTABLES=1 is set in the
+// environment.
+type ExecutableSource struct {
+	// Command is the command line to run, interpreted by "/bin/sh -c" (or
+	// "cmd /C" on Windows). Required.
+	Command string
+	// TimeoutMillis bounds how long the command may run. If zero, defaults
+	// to 30 seconds. Optional.
+	TimeoutMillis int
+	// OutputFile, if set, is where the executable is expected to cache its
+	// response; it is read first so the command need not be re-run on
+	// every token refresh.
+	OutputFile string
+}
+
+// executableResponse is the JSON contract documented for Google
+// executable-sourced credentials.
+type executableResponse struct {
+	Version        int    `json:"version"`
+	Success        bool   `json:"success"`
+	TokenType      string `json:"token_type"`
+	IDToken        string `json:"id_token"`
+	SAMLResponse   string `json:"saml_response"`
+	ExpirationTime int64  `json:"expiration_time"`
+	Code           string `json:"code"`
+	Message        string `json:"message"`
+}
+
+func subjectTokenFromExecutable(ctx context.Context, src *ExecutableSource, audience, subjectTokenType string) (string, error) {
+	if os.Getenv(allowExecutablesEnvVar) != "1" {
+		return "", fmt.Errorf("externalaccount: executable sources are disabled; set %s=1 to allow running %q", allowExecutablesEnvVar, src.Command)
+	}
+
+	if src.OutputFile != "" {
+		if body, err := os.ReadFile(src.OutputFile); err == nil {
+			if token, err := parseExecutableResponse(body); err == nil {
+				return token, nil
+			}
+			// Fall through and re-run the command if the cached file is
+			// missing, stale, or invalid.
+		}
+	}
+
+	timeout := defaultExecutableTimeout
+	if src.TimeoutMillis > 0 {
+		timeout = time.Duration(src.TimeoutMillis) * time.Millisecond
+	}
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	shell, flag := "/bin/sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+	cmd := exec.CommandContext(runCtx, shell, flag, src.Command)
+	cmd.Env = append(os.Environ(),
+		"GOOGLE_EXTERNAL_ACCOUNT_AUDIENCE="+audience,
+		"GOOGLE_EXTERNAL_ACCOUNT_TOKEN_TYPE="+subjectTokenType,
+		"GOOGLE_EXTERNAL_ACCOUNT_OUTPUT_FILE="+src.OutputFile,
+		"GOOGLE_EXTERNAL_ACCOUNT_INTERACTIVE=0",
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("externalaccount: executable failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	token, err := parseExecutableResponse(stdout.Bytes())
+	if err != nil {
+		return "", err
+	}
+	if src.OutputFile != "" {
+		// Best-effort cache write; a failure here shouldn't fail the token
+		// fetch since we already have a valid token in hand.
+		_ = os.WriteFile(src.OutputFile, stdout.Bytes(), 0600)
+	}
+	return token, nil
+}
+
+func parseExecutableResponse(body []byte) (string, error) {
+	var resp executableResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("externalaccount: unable to parse executable response: %w", err)
+	}
+	if !resp.Success {
+		return "", fmt.Errorf("externalaccount: executable reported failure: %s: %s", resp.Code, resp.Message)
+	}
+	if resp.ExpirationTime != 0 && time.Now().Unix() > resp.ExpirationTime {
+		return "", errors.New("externalaccount: executable response is expired")
+	}
+	switch {
+	case resp.SAMLResponse != "":
+		return resp.SAMLResponse, nil
+	case resp.IDToken != "":
+		return resp.IDToken, nil
+	default:
+		return "", errors.New("externalaccount: executable response has no id_token or saml_response")
+	}
+}
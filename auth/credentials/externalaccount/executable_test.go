@@ -0,0 +1,83 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package externalaccount
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSubjectTokenFromExecutable_DisabledByDefault(t *testing.T) {
+	t.Setenv(allowExecutablesEnvVar, "")
+	src := &ExecutableSource{Command: "echo should-not-run"}
+	if _, err := subjectTokenFromExecutable(context.Background(), src, "aud", "token-type"); err == nil {
+		t.Error("subjectTokenFromExecutable: got nil error, want error when executables are disabled")
+	}
+}
+
+func TestSubjectTokenFromExecutable_Success(t *testing.T) {
+	t.Setenv(allowExecutablesEnvVar, "1")
+	cmd := `echo '{"version":1,"success":true,"token_type":"urn:ietf:params:oauth:token-type:id_token","id_token":"exec-subject-token"}'`
+	src := &ExecutableSource{Command: cmd}
+	got, err := subjectTokenFromExecutable(context.Background(), src, "aud", "token-type")
+	if err != nil {
+		t.Fatalf("subjectTokenFromExecutable: %v", err)
+	}
+	if want := "exec-subject-token"; got != want {
+		t.Errorf("subjectTokenFromExecutable() = %q, want %q", got, want)
+	}
+}
+
+func TestSubjectTokenFromExecutable_Failure(t *testing.T) {
+	t.Setenv(allowExecutablesEnvVar, "1")
+	cmd := `echo '{"version":1,"success":false,"code":"403","message":"permission denied"}'`
+	src := &ExecutableSource{Command: cmd}
+	if _, err := subjectTokenFromExecutable(context.Background(), src, "aud", "token-type"); err == nil {
+		t.Error("subjectTokenFromExecutable: got nil error, want error for success=false response")
+	}
+}
+
+func TestSubjectTokenFromExecutable_ExpiredResponse(t *testing.T) {
+	t.Setenv(allowExecutablesEnvVar, "1")
+	cmd := fmt.Sprintf(`echo '{"version":1,"success":true,"id_token":"stale-token","expiration_time":%d}'`, time.Now().Add(-time.Hour).Unix())
+	src := &ExecutableSource{Command: cmd}
+	if _, err := subjectTokenFromExecutable(context.Background(), src, "aud", "token-type"); err == nil {
+		t.Error("subjectTokenFromExecutable: got nil error, want error for expired response")
+	}
+}
+
+func TestSubjectTokenFromExecutable_CachedOutputFile(t *testing.T) {
+	t.Setenv(allowExecutablesEnvVar, "1")
+	path := filepath.Join(t.TempDir(), "cache.json")
+	if err := os.WriteFile(path, []byte(`{"version":1,"success":true,"id_token":"cached-token"}`), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	src := &ExecutableSource{
+		Command:    "echo should-not-run-because-cache-is-fresh",
+		OutputFile: path,
+	}
+	got, err := subjectTokenFromExecutable(context.Background(), src, "aud", "token-type")
+	if err != nil {
+		t.Fatalf("subjectTokenFromExecutable: %v", err)
+	}
+	if want := "cached-token"; got != want {
+		t.Errorf("subjectTokenFromExecutable() = %q, want %q (should have used cached file, not run command)", got, want)
+	}
+}
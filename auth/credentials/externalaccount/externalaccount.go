@@ -0,0 +1,297 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package externalaccount produces [cloud.google.com/go/auth.Credentials]
+// for workload identity federation: a non-Google identity (a URL- or
+// file-sourced token, AWS, or the output of an executable) is exchanged at
+// Google's Security Token Service for a federated Google access token. The
+// resulting credentials can be used directly, or passed as
+// [cloud.google.com/go/auth/credentials/impersonate.IDTokenOptions.Credentials]
+// or
+// [cloud.google.com/go/auth/credentials/impersonate.CredentialsOptions.Credentials]
+// to further impersonate a service account without a downloaded key file.
+package externalaccount
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/auth"
+	"cloud.google.com/go/auth/internal"
+	"github.com/googleapis/gax-go/v2/internallog"
+)
+
+// defaultTokenURL is Google's Security Token Service token exchange
+// endpoint.
+const defaultTokenURL = "https://sts.googleapis.com/v1/token"
+
+var defaultScopes = []string{"https://www.googleapis.com/auth/cloud-platform"}
+
+// SubjectTokenFormat describes how to extract a subject token from a
+// URLSource or FileSource response. The zero value reads the response as
+// plain text.
+type SubjectTokenFormat struct {
+	// Type is either "json" or "text". If empty, "text" is assumed.
+	Type string
+	// SubjectTokenFieldName is the JSON field holding the subject token.
+	// Required when Type is "json".
+	SubjectTokenFieldName string
+}
+
+// URLSource fetches a subject token by making an HTTP GET request to a URL,
+// such as a metadata server local to the workload.
+type URLSource struct {
+	// URL to query for the subject token. Required.
+	URL string
+	// Headers to send with the request. Optional.
+	Headers map[string]string
+	// Format of the response body. Optional.
+	Format SubjectTokenFormat
+}
+
+// FileSource reads a subject token from a local file, such as one mounted
+// into a Kubernetes pod by a projected volume.
+type FileSource struct {
+	// Path to the file containing the subject token. Required.
+	Path string
+	// Format of the file contents. Optional.
+	Format SubjectTokenFormat
+}
+
+// CredentialSource selects where the subject token that is exchanged for a
+// federated Google token comes from. Exactly one field must be set.
+type CredentialSource struct {
+	URL        *URLSource
+	File       *FileSource
+	AWS        *AWSSource
+	Executable *ExecutableSource
+}
+
+func (c CredentialSource) validate() error {
+	n := 0
+	for _, set := range []bool{c.URL != nil, c.File != nil, c.AWS != nil, c.Executable != nil} {
+		if set {
+			n++
+		}
+	}
+	if n != 1 {
+		return errors.New("externalaccount: exactly one of CredentialSource.URL, File, AWS, or Executable must be set")
+	}
+	return nil
+}
+
+// Options for constructing workload identity federation credentials.
+type Options struct {
+	// Audience is the Security Token Service audience, which identifies the
+	// workload identity pool and provider, for example
+	// "//iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/my-pool/providers/my-provider".
+	// Required.
+	Audience string
+	// SubjectTokenType is the STS subject token type of the non-Google
+	// credential, for example "urn:ietf:params:oauth:token-type:jwt" for an
+	// OIDC source or "urn:ietf:params:aws:token-type:aws4_request" for AWS.
+	// Required.
+	SubjectTokenType string
+	// CredentialSource describes how to obtain the subject token. Required.
+	CredentialSource CredentialSource
+	// TokenURL is the Security Token Service token exchange endpoint. If
+	// empty, Google's endpoint is used. Optional.
+	TokenURL string
+	// Scopes for the federated access token. If empty, defaults to
+	// https://www.googleapis.com/auth/cloud-platform. Optional.
+	Scopes []string
+
+	// Client configures the underlying client used to make network
+	// requests. Optional.
+	Client *http.Client
+	// Logger is used for debug logging. If provided, logging will be
+	// enabled at the loggers configured level. By default logging is
+	// disabled unless enabled by setting GOOGLE_SDK_GO_LOGGING_LEVEL in
+	// which case a default logger will be used. Optional.
+	Logger *slog.Logger
+}
+
+func (o *Options) validate() error {
+	if o == nil {
+		return errors.New("externalaccount: options must be provided")
+	}
+	if o.Audience == "" {
+		return errors.New("externalaccount: audience must be provided")
+	}
+	if o.SubjectTokenType == "" {
+		return errors.New("externalaccount: subject token type must be provided")
+	}
+	return o.CredentialSource.validate()
+}
+
+// NewCredentials creates [cloud.google.com/go/auth.Credentials] that
+// exchange a subject token obtained from opts.CredentialSource for a
+// federated Google access token at the Security Token Service.
+func NewCredentials(opts *Options) (*auth.Credentials, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	logger := internallog.New(opts.Logger)
+	scopes := opts.Scopes
+	if len(scopes) == 0 {
+		scopes = defaultScopes
+	}
+	tokenURL := opts.TokenURL
+	if tokenURL == "" {
+		tokenURL = defaultTokenURL
+	}
+
+	tp := tokenProvider{
+		client:           client,
+		logger:           logger,
+		audience:         opts.Audience,
+		subjectTokenType: opts.SubjectTokenType,
+		tokenURL:         tokenURL,
+		scopes:           scopes,
+		source:           opts.CredentialSource,
+	}
+	return auth.NewCredentials(&auth.CredentialsOptions{
+		TokenProvider: auth.NewCachedTokenProvider(tp, nil),
+	}), nil
+}
+
+type stsTokenRequest struct {
+	GrantType          string `json:"grant_type"`
+	Audience           string `json:"audience"`
+	Scope              string `json:"scope"`
+	RequestedTokenType string `json:"requested_token_type"`
+	SubjectToken       string `json:"subject_token"`
+	SubjectTokenType   string `json:"subject_token_type"`
+}
+
+type stsTokenResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int64  `json:"expires_in"`
+}
+
+type tokenProvider struct {
+	client *http.Client
+	logger *slog.Logger
+
+	audience         string
+	subjectTokenType string
+	tokenURL         string
+	scopes           []string
+	source           CredentialSource
+}
+
+func (tp tokenProvider) Token(ctx context.Context) (*auth.Token, error) {
+	subjectToken, err := tp.subjectToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":           {"urn:ietf:params:oauth:grant-type:token-exchange"},
+		"audience":             {tp.audience},
+		"scope":                {strings.Join(tp.scopes, " ")},
+		"requested_token_type": {"urn:ietf:params:oauth:token-type:access_token"},
+		"subject_token":        {subjectToken},
+		"subject_token_type":   {tp.subjectTokenType},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", tp.tokenURL, bytes.NewReader([]byte(form.Encode())))
+	if err != nil {
+		return nil, fmt.Errorf("externalaccount: unable to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	tp.logger.DebugContext(ctx, "externalaccount sts request", "request", internallog.HTTPRequest(req, []byte(form.Encode())))
+	resp, body, err := internal.DoRequest(tp.client, req)
+	if err != nil {
+		return nil, fmt.Errorf("externalaccount: unable to exchange token: %w", err)
+	}
+	tp.logger.DebugContext(ctx, "externalaccount sts response", "response", internallog.HTTPResponse(resp, body))
+	if c := resp.StatusCode; c < 200 || c > 299 {
+		return nil, fmt.Errorf("externalaccount: status code %d: %s", c, body)
+	}
+
+	var stsResp stsTokenResponse
+	if err := json.Unmarshal(body, &stsResp); err != nil {
+		return nil, fmt.Errorf("externalaccount: unable to parse token response: %w", err)
+	}
+	return &auth.Token{
+		Value:  stsResp.AccessToken,
+		Expiry: time.Now().Add(time.Duration(stsResp.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// subjectToken dispatches to the configured credential source.
+func (tp tokenProvider) subjectToken(ctx context.Context) (string, error) {
+	switch {
+	case tp.source.URL != nil:
+		return subjectTokenFromURL(ctx, tp.client, tp.source.URL)
+	case tp.source.File != nil:
+		return subjectTokenFromFile(tp.source.File)
+	case tp.source.AWS != nil:
+		return subjectTokenFromAWS(ctx, tp.client, tp.source.AWS, tp.audience)
+	case tp.source.Executable != nil:
+		return subjectTokenFromExecutable(ctx, tp.source.Executable, tp.audience, tp.subjectTokenType)
+	default:
+		return "", errors.New("externalaccount: no credential source configured")
+	}
+}
+
+func extractSubjectToken(body []byte, format SubjectTokenFormat) (string, error) {
+	if format.Type != "json" {
+		return string(bytes.TrimSpace(body)), nil
+	}
+	if format.SubjectTokenFieldName == "" {
+		return "", errors.New("externalaccount: SubjectTokenFieldName is required for json format")
+	}
+	var parsed map[string]interface{}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return "", fmt.Errorf("externalaccount: unable to parse response as json: %w", err)
+	}
+	v, ok := parsed[format.SubjectTokenFieldName].(string)
+	if !ok {
+		return "", fmt.Errorf("externalaccount: field %q not found in response", format.SubjectTokenFieldName)
+	}
+	return v, nil
+}
+
+func subjectTokenFromURL(ctx context.Context, client *http.Client, src *URLSource) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", src.URL, nil)
+	if err != nil {
+		return "", fmt.Errorf("externalaccount: unable to create request: %w", err)
+	}
+	for k, v := range src.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, body, err := internal.DoRequest(client, req)
+	if err != nil {
+		return "", fmt.Errorf("externalaccount: unable to fetch subject token: %w", err)
+	}
+	if c := resp.StatusCode; c < 200 || c > 299 {
+		return "", fmt.Errorf("externalaccount: status code %d fetching subject token: %s", c, body)
+	}
+	return extractSubjectToken(body, src.Format)
+}
@@ -0,0 +1,243 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package externalaccount
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newSTSServer returns a fake Security Token Service endpoint that echoes
+// back a fixed access token, and asserts the exchange request carries the
+// expected subject token.
+func newSTSServer(t *testing.T, wantSubjectToken, respBody string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("ParseForm: %v", err)
+		}
+		if got := r.FormValue("subject_token"); got != wantSubjectToken {
+			t.Errorf("subject_token = %q, want %q", got, wantSubjectToken)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(respBody))
+	}))
+}
+
+func TestNewCredentials_URLSource(t *testing.T) {
+	subjectSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("url-subject-token"))
+	}))
+	defer subjectSrv.Close()
+	stsSrv := newSTSServer(t, "url-subject-token", `{"access_token":"federated-token","expires_in":3600}`)
+	defer stsSrv.Close()
+
+	creds, err := NewCredentials(&Options{
+		Audience:         "//iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/pool/providers/provider",
+		SubjectTokenType: "urn:ietf:params:oauth:token-type:jwt",
+		TokenURL:         stsSrv.URL,
+		CredentialSource: CredentialSource{
+			URL: &URLSource{URL: subjectSrv.URL},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewCredentials: %v", err)
+	}
+	tok, err := creds.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if got, want := tok.Value, "federated-token"; got != want {
+		t.Errorf("token = %q, want %q", got, want)
+	}
+}
+
+func TestNewCredentials_STSError(t *testing.T) {
+	subjectSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("url-subject-token"))
+	}))
+	defer subjectSrv.Close()
+	stsSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+	}))
+	defer stsSrv.Close()
+
+	creds, err := NewCredentials(&Options{
+		Audience:         "//iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/pool/providers/provider",
+		SubjectTokenType: "urn:ietf:params:oauth:token-type:jwt",
+		TokenURL:         stsSrv.URL,
+		CredentialSource: CredentialSource{
+			URL: &URLSource{URL: subjectSrv.URL},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewCredentials: %v", err)
+	}
+	if _, err := creds.Token(context.Background()); err == nil {
+		t.Error("Token: got nil error, want error from STS")
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    *Options
+		wantErr bool
+	}{
+		{name: "nil", opts: nil, wantErr: true},
+		{
+			name:    "missing audience",
+			opts:    &Options{SubjectTokenType: "t", CredentialSource: CredentialSource{URL: &URLSource{}}},
+			wantErr: true,
+		},
+		{
+			name:    "missing subject token type",
+			opts:    &Options{Audience: "aud", CredentialSource: CredentialSource{URL: &URLSource{}}},
+			wantErr: true,
+		},
+		{
+			name:    "no credential source set",
+			opts:    &Options{Audience: "aud", SubjectTokenType: "t"},
+			wantErr: true,
+		},
+		{
+			name: "multiple credential sources set",
+			opts: &Options{
+				Audience:         "aud",
+				SubjectTokenType: "t",
+				CredentialSource: CredentialSource{URL: &URLSource{}, File: &FileSource{}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid",
+			opts: &Options{
+				Audience:         "aud",
+				SubjectTokenType: "t",
+				CredentialSource: CredentialSource{URL: &URLSource{}},
+			},
+			wantErr: false,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.opts.validate()
+			if (err != nil) != tc.wantErr {
+				t.Errorf("validate() = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestExtractSubjectToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		format  SubjectTokenFormat
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "text default",
+			body: "  raw-token  \n",
+			want: "raw-token",
+		},
+		{
+			name:   "json",
+			body:   `{"token":"nested-token"}`,
+			format: SubjectTokenFormat{Type: "json", SubjectTokenFieldName: "token"},
+			want:   "nested-token",
+		},
+		{
+			name:    "json missing field name",
+			body:    `{"token":"nested-token"}`,
+			format:  SubjectTokenFormat{Type: "json"},
+			wantErr: true,
+		},
+		{
+			name:    "json field not found",
+			body:    `{"other":"value"}`,
+			format:  SubjectTokenFormat{Type: "json", SubjectTokenFieldName: "token"},
+			wantErr: true,
+		},
+		{
+			name:    "json malformed",
+			body:    `not json`,
+			format:  SubjectTokenFormat{Type: "json", SubjectTokenFieldName: "token"},
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := extractSubjectToken([]byte(tc.body), tc.format)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("extractSubjectToken() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if err == nil && got != tc.want {
+				t.Errorf("extractSubjectToken() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSubjectTokenFromURL_Headers(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.Header.Get("X-Custom"), "custom-value"; got != want {
+			t.Errorf("X-Custom header = %q, want %q", got, want)
+		}
+		w.Write([]byte("subject-token"))
+	}))
+	defer srv.Close()
+
+	got, err := subjectTokenFromURL(context.Background(), http.DefaultClient, &URLSource{
+		URL:     srv.URL,
+		Headers: map[string]string{"X-Custom": "custom-value"},
+	})
+	if err != nil {
+		t.Fatalf("subjectTokenFromURL: %v", err)
+	}
+	if want := "subject-token"; got != want {
+		t.Errorf("subjectTokenFromURL() = %q, want %q", got, want)
+	}
+}
+
+func TestSubjectTokenFromURL_Error(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	if _, err := subjectTokenFromURL(context.Background(), http.DefaultClient, &URLSource{URL: srv.URL}); err == nil {
+		t.Error("subjectTokenFromURL: got nil error, want error")
+	}
+}
+
+func TestNewCredentials_SubjectTokenError(t *testing.T) {
+	creds, err := NewCredentials(&Options{
+		Audience:         "aud",
+		SubjectTokenType: "t",
+		CredentialSource: CredentialSource{
+			URL: &URLSource{URL: "http://127.0.0.1:0/unreachable"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewCredentials: %v", err)
+	}
+	if _, err := creds.Token(context.Background()); err == nil {
+		t.Error("Token: got nil error, want error fetching subject token")
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package externalaccount
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSubjectTokenFromFile_Text(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("  file-subject-token  \n"), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	got, err := subjectTokenFromFile(&FileSource{Path: path})
+	if err != nil {
+		t.Fatalf("subjectTokenFromFile: %v", err)
+	}
+	if want := "file-subject-token"; got != want {
+		t.Errorf("subjectTokenFromFile() = %q, want %q", got, want)
+	}
+}
+
+func TestSubjectTokenFromFile_JSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+	if err := os.WriteFile(path, []byte(`{"subject_token":"nested-file-token"}`), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	got, err := subjectTokenFromFile(&FileSource{
+		Path:   path,
+		Format: SubjectTokenFormat{Type: "json", SubjectTokenFieldName: "subject_token"},
+	})
+	if err != nil {
+		t.Fatalf("subjectTokenFromFile: %v", err)
+	}
+	if want := "nested-file-token"; got != want {
+		t.Errorf("subjectTokenFromFile() = %q, want %q", got, want)
+	}
+}
+
+func TestSubjectTokenFromFile_Missing(t *testing.T) {
+	if _, err := subjectTokenFromFile(&FileSource{Path: filepath.Join(t.TempDir(), "missing")}); err == nil {
+		t.Error("subjectTokenFromFile: got nil error, want error for missing file")
+	}
+}
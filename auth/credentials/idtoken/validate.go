@@ -0,0 +1,374 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package idtoken verifies Google-issued ID tokens, such as those produced
+// by [cloud.google.com/go/auth/credentials/impersonate] or the Compute
+// Engine metadata server.
+package idtoken
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Google's published JWKS endpoints. Tokens minted by IAM Credentials and
+// the self-signed JWT flow are signed with keys from the first; tokens
+// verified via the Identity-Aware Proxy are signed with keys from the
+// second.
+var (
+	googleOAuth2CertsURL = "https://www.googleapis.com/oauth2/v3/certs"
+	googleIAPCertsURL    = "https://www.gstatic.com/iap/verify/public_key-jwk"
+)
+
+// clockSkew is the amount of slack allowed when comparing the token's `exp`
+// and `iat` claims against the current time.
+const clockSkew = 1 * time.Minute
+
+// acceptedIssuers are the `iss` claim values accepted from a Google-issued
+// ID token.
+var acceptedIssuers = map[string]bool{
+	"accounts.google.com":         true,
+	"https://accounts.google.com": true,
+}
+
+// Payload is the decoded and verified contents of a Google ID token.
+type Payload struct {
+	// Issuer is the `iss` claim.
+	Issuer string
+	// Audience is the `aud` claim.
+	Audience string
+	// Subject is the `sub` claim, typically the unique identifier of the
+	// service account or user the token was issued for.
+	Subject string
+	// Expires is the `exp` claim, in seconds since the Unix epoch.
+	Expires int64
+	// IssuedAt is the `iat` claim, in seconds since the Unix epoch.
+	IssuedAt int64
+	// Claims holds every claim in the token's payload, including standard
+	// claims already surfaced above and extras such as `email`,
+	// `email_verified`, and `hd`.
+	Claims map[string]interface{}
+}
+
+// Validate parses a base64url-encoded, dot-separated Google ID token,
+// verifies its RS256 or ES256 signature against Google's published JSON Web
+// Key Sets, and checks that the token's `iss`, `aud`, `exp`, and `iat`
+// claims are valid for audience. Keys are fetched lazily and cached keyed by
+// `kid` across calls.
+func Validate(ctx context.Context, token, audience string) (*Payload, error) {
+	return defaultValidator.validate(ctx, token, audience)
+}
+
+var defaultValidator = newValidator(http.DefaultClient)
+
+// validator fetches and caches Google's JWKS so repeated calls to Validate
+// don't re-fetch keys on every token.
+type validator struct {
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]*cachedKeySet // keyed by JWKS URL
+}
+
+type cachedKeySet struct {
+	keys       map[string]*jwk
+	expires    time.Time
+	refreshAt  time.Time
+	refreshing bool
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwksResponse struct {
+	Keys []*jwk `json:"keys"`
+}
+
+func newValidator(client *http.Client) *validator {
+	return &validator{
+		client: client,
+		cache:  map[string]*cachedKeySet{},
+	}
+}
+
+func (v *validator) validate(ctx context.Context, token, audience string) (*Payload, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("idtoken: invalid token, expected 3 segments")
+	}
+
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("idtoken: unable to decode header: %w", err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerBytes, &header); err != nil {
+		return nil, fmt.Errorf("idtoken: unable to parse header: %w", err)
+	}
+
+	payloadBytes, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("idtoken: unable to decode payload: %w", err)
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payloadBytes, &claims); err != nil {
+		return nil, fmt.Errorf("idtoken: unable to parse payload: %w", err)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("idtoken: unable to decode signature: %w", err)
+	}
+
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signedContent := parts[0] + "." + parts[1]
+	if err := verifySignature(header.Alg, key, signedContent, sig); err != nil {
+		return nil, err
+	}
+
+	iss, _ := claims["iss"].(string)
+	if !acceptedIssuers[iss] {
+		return nil, fmt.Errorf("idtoken: invalid issuer %q", iss)
+	}
+	aud, _ := claims["aud"].(string)
+	if aud != audience {
+		return nil, fmt.Errorf("idtoken: audience %q does not match expected %q", aud, audience)
+	}
+	exp, err := claimInt64(claims, "exp")
+	if err != nil {
+		return nil, err
+	}
+	iat, err := claimInt64(claims, "iat")
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if now.After(time.Unix(exp, 0).Add(clockSkew)) {
+		return nil, errors.New("idtoken: token is expired")
+	}
+	if now.Before(time.Unix(iat, 0).Add(-clockSkew)) {
+		return nil, errors.New("idtoken: token used before issued")
+	}
+
+	sub, _ := claims["sub"].(string)
+	return &Payload{
+		Issuer:   iss,
+		Audience: aud,
+		Subject:  sub,
+		Expires:  exp,
+		IssuedAt: iat,
+		Claims:   claims,
+	}, nil
+}
+
+func claimInt64(claims map[string]interface{}, name string) (int64, error) {
+	v, ok := claims[name].(float64)
+	if !ok {
+		return 0, fmt.Errorf("idtoken: missing or invalid %q claim", name)
+	}
+	return int64(v), nil
+}
+
+func verifySignature(alg string, key *jwk, signedContent string, sig []byte) error {
+	hashed := sha256.Sum256([]byte(signedContent))
+	switch alg {
+	case "RS256":
+		pub, err := rsaPublicKey(key)
+		if err != nil {
+			return err
+		}
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, hashed[:], sig); err != nil {
+			return fmt.Errorf("idtoken: invalid RS256 signature: %w", err)
+		}
+		return nil
+	case "ES256":
+		pub, err := ecdsaPublicKey(key)
+		if err != nil {
+			return err
+		}
+		if len(sig) != 64 {
+			return errors.New("idtoken: invalid ES256 signature length")
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, hashed[:], r, s) {
+			return errors.New("idtoken: invalid ES256 signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("idtoken: unsupported signing algorithm %q", alg)
+	}
+}
+
+func rsaPublicKey(key *jwk) (*rsa.PublicKey, error) {
+	nBytes, err := base64.RawURLEncoding.DecodeString(key.N)
+	if err != nil {
+		return nil, fmt.Errorf("idtoken: unable to decode RSA modulus: %w", err)
+	}
+	eBytes, err := base64.RawURLEncoding.DecodeString(key.E)
+	if err != nil {
+		return nil, fmt.Errorf("idtoken: unable to decode RSA exponent: %w", err)
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(nBytes),
+		E: int(new(big.Int).SetBytes(eBytes).Int64()),
+	}, nil
+}
+
+func ecdsaPublicKey(key *jwk) (*ecdsa.PublicKey, error) {
+	xBytes, err := base64.RawURLEncoding.DecodeString(key.X)
+	if err != nil {
+		return nil, fmt.Errorf("idtoken: unable to decode EC x coordinate: %w", err)
+	}
+	yBytes, err := base64.RawURLEncoding.DecodeString(key.Y)
+	if err != nil {
+		return nil, fmt.Errorf("idtoken: unable to decode EC y coordinate: %w", err)
+	}
+	return &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(xBytes),
+		Y:     new(big.Int).SetBytes(yBytes),
+	}, nil
+}
+
+// key returns the JWK for kid, checking both of Google's JWKS endpoints.
+func (v *validator) key(ctx context.Context, kid string) (*jwk, error) {
+	for _, url := range []string{googleOAuth2CertsURL, googleIAPCertsURL} {
+		keys, err := v.keysForURL(ctx, url)
+		if err != nil {
+			continue
+		}
+		if k, ok := keys[kid]; ok {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("idtoken: unable to find key with kid %q", kid)
+}
+
+func (v *validator) keysForURL(ctx context.Context, url string) (map[string]*jwk, error) {
+	v.mu.Lock()
+	cs, ok := v.cache[url]
+	if ok && time.Now().Before(cs.expires) {
+		if time.Now().After(cs.refreshAt) && !cs.refreshing {
+			cs.refreshing = true
+			go v.refresh(url)
+		}
+		keys := cs.keys
+		v.mu.Unlock()
+		return keys, nil
+	}
+	v.mu.Unlock()
+	return v.fetch(ctx, url)
+}
+
+// refresh re-fetches url in the background, ahead of its expiry, so callers
+// rarely block on a synchronous fetch. If the fetch fails, the existing
+// cache entry's refreshing flag is cleared so a later call can try again,
+// rather than leaving background refresh disabled until the entry expires.
+func (v *validator) refresh(url string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if _, err := v.fetch(ctx, url); err != nil {
+		v.mu.Lock()
+		if cs, ok := v.cache[url]; ok {
+			cs.refreshing = false
+		}
+		v.mu.Unlock()
+	}
+}
+
+func (v *validator) fetch(ctx context.Context, url string) (map[string]*jwk, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("idtoken: unable to create request: %w", err)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("idtoken: unable to fetch keys from %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("idtoken: unable to read response from %s: %w", url, err)
+	}
+	if c := resp.StatusCode; c < 200 || c > 299 {
+		return nil, fmt.Errorf("idtoken: status code %d fetching %s: %s", c, url, body)
+	}
+
+	var jr jwksResponse
+	if err := json.Unmarshal(body, &jr); err != nil {
+		return nil, fmt.Errorf("idtoken: unable to parse keys from %s: %w", url, err)
+	}
+	keys := make(map[string]*jwk, len(jr.Keys))
+	for _, k := range jr.Keys {
+		keys[k.Kid] = k
+	}
+
+	ttl := 1 * time.Hour
+	if ma := maxAge(resp.Header.Get("Cache-Control")); ma > 0 {
+		ttl = ma
+	}
+	now := time.Now()
+	v.mu.Lock()
+	v.cache[url] = &cachedKeySet{
+		keys:      keys,
+		expires:   now.Add(ttl),
+		refreshAt: now.Add(ttl / 2),
+	}
+	v.mu.Unlock()
+	return keys, nil
+}
+
+// maxAge parses the max-age directive out of a Cache-Control header value,
+// returning 0 if absent or invalid.
+func maxAge(cacheControl string) time.Duration {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.TrimSpace(directive)
+		if secs, ok := strings.CutPrefix(directive, "max-age="); ok {
+			if n, err := strconv.Atoi(secs); err == nil && n > 0 {
+				return time.Duration(n) * time.Second
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,311 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package idtoken
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAudience = "https://example.com"
+
+func signToken(t *testing.T, alg, kid string, claims map[string]interface{}, sign func(signedContent []byte) []byte) string {
+	t.Helper()
+	headerJSON, err := json.Marshal(map[string]string{"alg": alg, "kid": kid})
+	if err != nil {
+		t.Fatalf("marshal header: %v", err)
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("marshal claims: %v", err)
+	}
+	signedContent := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	sig := sign([]byte(signedContent))
+	return signedContent + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func rsaSigner(priv *rsa.PrivateKey) func([]byte) []byte {
+	return func(signedContent []byte) []byte {
+		hashed := sha256.Sum256(signedContent)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, hashed[:])
+		if err != nil {
+			panic(err)
+		}
+		return sig
+	}
+}
+
+func ecdsaSigner(priv *ecdsa.PrivateKey) func([]byte) []byte {
+	return func(signedContent []byte) []byte {
+		hashed := sha256.Sum256(signedContent)
+		r, s, err := ecdsa.Sign(rand.Reader, priv, hashed[:])
+		if err != nil {
+			panic(err)
+		}
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig
+	}
+}
+
+func rsaJWK(t *testing.T, kid string) (*rsa.PrivateKey, *jwk) {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey: %v", err)
+	}
+	return priv, &jwk{
+		Kty: "RSA",
+		Alg: "RS256",
+		Kid: kid,
+		N:   base64.RawURLEncoding.EncodeToString(priv.PublicKey.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(priv.PublicKey.E)).Bytes()),
+	}
+}
+
+func ecdsaJWK(t *testing.T, kid string) (*ecdsa.PrivateKey, *jwk) {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey: %v", err)
+	}
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	priv.PublicKey.X.FillBytes(x)
+	priv.PublicKey.Y.FillBytes(y)
+	return priv, &jwk{
+		Kty: "EC",
+		Alg: "ES256",
+		Kid: kid,
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(x),
+		Y:   base64.RawURLEncoding.EncodeToString(y),
+	}
+}
+
+// newJWKSServer serves keys as Google's JWKS endpoints for both
+// googleOAuth2CertsURL and googleIAPCertsURL, and restores the originals on
+// test cleanup.
+func newJWKSServer(t *testing.T, keys ...*jwk) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(jwksResponse{Keys: keys})
+	}))
+	t.Cleanup(srv.Close)
+
+	origOAuth2, origIAP := googleOAuth2CertsURL, googleIAPCertsURL
+	googleOAuth2CertsURL, googleIAPCertsURL = srv.URL, srv.URL
+	t.Cleanup(func() { googleOAuth2CertsURL, googleIAPCertsURL = origOAuth2, origIAP })
+	return srv
+}
+
+func validClaims(now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"iss": "accounts.google.com",
+		"aud": testAudience,
+		"sub": "12345",
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+}
+
+func TestValidate_RS256(t *testing.T) {
+	priv, key := rsaJWK(t, "rsa-1")
+	newJWKSServer(t, key)
+	v := newValidator(http.DefaultClient)
+
+	now := time.Now()
+	token := signToken(t, "RS256", "rsa-1", validClaims(now), rsaSigner(priv))
+	payload, err := v.validate(context.Background(), token, testAudience)
+	if err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if payload.Subject != "12345" {
+		t.Errorf("Subject = %q, want %q", payload.Subject, "12345")
+	}
+	if payload.Issuer != "accounts.google.com" {
+		t.Errorf("Issuer = %q, want %q", payload.Issuer, "accounts.google.com")
+	}
+}
+
+func TestValidate_ES256(t *testing.T) {
+	priv, key := ecdsaJWK(t, "ec-1")
+	newJWKSServer(t, key)
+	v := newValidator(http.DefaultClient)
+
+	now := time.Now()
+	token := signToken(t, "ES256", "ec-1", validClaims(now), ecdsaSigner(priv))
+	payload, err := v.validate(context.Background(), token, testAudience)
+	if err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if payload.Audience != testAudience {
+		t.Errorf("Audience = %q, want %q", payload.Audience, testAudience)
+	}
+}
+
+func TestValidate_Errors(t *testing.T) {
+	priv, key := rsaJWK(t, "rsa-1")
+	newJWKSServer(t, key)
+	v := newValidator(http.DefaultClient)
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		kid    string
+		tamper func(token string) string
+	}{
+		{
+			name: "invalid issuer",
+			claims: func() map[string]interface{} {
+				c := validClaims(now)
+				c["iss"] = "https://evil.example.com"
+				return c
+			}(),
+			kid: "rsa-1",
+		},
+		{
+			name: "invalid audience",
+			claims: func() map[string]interface{} {
+				c := validClaims(now)
+				c["aud"] = "https://other.example.com"
+				return c
+			}(),
+			kid: "rsa-1",
+		},
+		{
+			name: "expired",
+			claims: func() map[string]interface{} {
+				c := validClaims(now)
+				c["exp"] = now.Add(-2 * time.Hour).Unix()
+				return c
+			}(),
+			kid: "rsa-1",
+		},
+		{
+			name: "used before issued",
+			claims: func() map[string]interface{} {
+				c := validClaims(now)
+				c["iat"] = now.Add(2 * time.Hour).Unix()
+				return c
+			}(),
+			kid: "rsa-1",
+		},
+		{
+			name:   "unknown kid",
+			claims: validClaims(now),
+			kid:    "rsa-unknown",
+		},
+		{
+			name:   "tampered signature",
+			claims: validClaims(now),
+			kid:    "rsa-1",
+			tamper: func(token string) string {
+				// Change the first signature character: unlike the last one,
+				// all six of its bits land in the decoded signature.
+				i := strings.LastIndex(token, ".") + 1
+				c := "A"
+				if token[i] == 'A' {
+					c = "B"
+				}
+				return token[:i] + c + token[i+1:]
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			token := signToken(t, "RS256", tc.kid, tc.claims, rsaSigner(priv))
+			if tc.tamper != nil {
+				token = tc.tamper(token)
+			}
+			if _, err := v.validate(context.Background(), token, testAudience); err == nil {
+				t.Error("validate: got nil error, want error")
+			}
+		})
+	}
+}
+
+func TestValidate_MalformedToken(t *testing.T) {
+	v := newValidator(http.DefaultClient)
+	tests := []string{"", "not-a-jwt", "a.b", "!!!.!!!.!!!"}
+	for _, tok := range tests {
+		if _, err := v.validate(context.Background(), tok, testAudience); err == nil {
+			t.Errorf("validate(%q): got nil error, want error", tok)
+		}
+	}
+}
+
+// TestRefreshResetsRefreshingOnFailure exercises the fix where a failed
+// background JWKS refresh must clear the cache entry's refreshing flag, so a
+// later refresh attempt isn't permanently suppressed until the entry's full
+// TTL expires.
+func TestRefreshResetsRefreshingOnFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	v := newValidator(http.DefaultClient)
+	v.cache[srv.URL] = &cachedKeySet{
+		keys:       map[string]*jwk{},
+		expires:    time.Now().Add(time.Hour),
+		refreshAt:  time.Now().Add(-time.Minute),
+		refreshing: true,
+	}
+
+	v.refresh(srv.URL)
+
+	v.mu.Lock()
+	refreshing := v.cache[srv.URL].refreshing
+	v.mu.Unlock()
+	if refreshing {
+		t.Error("refreshing = true after failed refresh, want false so a later call can retry")
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	tests := []struct {
+		cacheControl string
+		want         time.Duration
+	}{
+		{"max-age=3600", 3600 * time.Second},
+		{"public, max-age=60, must-revalidate", 60 * time.Second},
+		{"no-cache", 0},
+		{"", 0},
+		{"max-age=0", 0},
+		{"max-age=-5", 0},
+	}
+	for _, tc := range tests {
+		if got := maxAge(tc.cacheControl); got != tc.want {
+			t.Errorf("maxAge(%q) = %v, want %v", tc.cacheControl, got, tc.want)
+		}
+	}
+}
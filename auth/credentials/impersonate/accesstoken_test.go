@@ -0,0 +1,182 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package impersonate
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewCredentials(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"accessToken":"impersonated-access-token","expireTime":"2030-01-01T00:00:00Z"}`))
+	}))
+	defer srv.Close()
+	origIAM := iamCredentialsEndpoint
+	iamCredentialsEndpoint = srv.URL
+	defer func() { iamCredentialsEndpoint = origIAM }()
+
+	creds, err := NewCredentials(&CredentialsOptions{
+		TargetPrincipal: "sa@project.iam.gserviceaccount.com",
+		Scopes:          []string{"https://www.googleapis.com/auth/cloud-platform"},
+		Client:          http.DefaultClient,
+	})
+	if err != nil {
+		t.Fatalf("NewCredentials: %v", err)
+	}
+	tok, err := creds.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if got, want := tok.Value, "impersonated-access-token"; got != want {
+		t.Errorf("token = %q, want %q", got, want)
+	}
+	wantExpiry, _ := time.Parse(time.RFC3339, "2030-01-01T00:00:00Z")
+	if !tok.Expiry.Equal(wantExpiry) {
+		t.Errorf("expiry = %v, want %v", tok.Expiry, wantExpiry)
+	}
+}
+
+func TestNewCredentials_IAMError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"error":"permission denied"}`))
+	}))
+	defer srv.Close()
+	origIAM := iamCredentialsEndpoint
+	iamCredentialsEndpoint = srv.URL
+	defer func() { iamCredentialsEndpoint = origIAM }()
+
+	creds, err := NewCredentials(&CredentialsOptions{
+		TargetPrincipal: "sa@project.iam.gserviceaccount.com",
+		Scopes:          []string{"https://www.googleapis.com/auth/cloud-platform"},
+		Client:          http.DefaultClient,
+	})
+	if err != nil {
+		t.Fatalf("NewCredentials: %v", err)
+	}
+	if _, err := creds.Token(context.Background()); err == nil {
+		t.Error("Token: got nil error, want error from IAM Credentials")
+	}
+}
+
+func TestCredentialsOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    *CredentialsOptions
+		wantErr bool
+	}{
+		{
+			name:    "nil",
+			opts:    nil,
+			wantErr: true,
+		},
+		{
+			name:    "missing target principal",
+			opts:    &CredentialsOptions{Scopes: []string{"scope"}},
+			wantErr: true,
+		},
+		{
+			name:    "missing scopes",
+			opts:    &CredentialsOptions{TargetPrincipal: "sa@project.iam.gserviceaccount.com"},
+			wantErr: true,
+		},
+		{
+			name: "negative lifetime",
+			opts: &CredentialsOptions{
+				TargetPrincipal: "sa@project.iam.gserviceaccount.com",
+				Scopes:          []string{"scope"},
+				Lifetime:        -1 * time.Second,
+			},
+			wantErr: true,
+		},
+		{
+			name: "lifetime exceeds max",
+			opts: &CredentialsOptions{
+				TargetPrincipal: "sa@project.iam.gserviceaccount.com",
+				Scopes:          []string{"scope"},
+				Lifetime:        13 * time.Hour,
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid",
+			opts: &CredentialsOptions{
+				TargetPrincipal: "sa@project.iam.gserviceaccount.com",
+				Scopes:          []string{"scope"},
+			},
+			wantErr: false,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.opts.validate()
+			if (err != nil) != tc.wantErr {
+				t.Errorf("validate() = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewCredentialsWithSubject(t *testing.T) {
+	srv := newSignJwtAndTokenServer(t, "fake.at.signed.jwt", `{"access_token":"subject-access-token","expires_in":3600}`)
+	defer srv.Close()
+	origIAM, origToken := iamCredentialsEndpoint, googleTokenEndpoint
+	iamCredentialsEndpoint, googleTokenEndpoint = srv.URL, srv.URL
+	defer func() { iamCredentialsEndpoint, googleTokenEndpoint = origIAM, origToken }()
+
+	creds, err := NewCredentialsWithSubject(&CredentialsOptions{
+		TargetPrincipal: "sa@project.iam.gserviceaccount.com",
+		Scopes:          []string{"https://www.googleapis.com/auth/cloud-platform"},
+		Client:          http.DefaultClient,
+	}, "user@example.com")
+	if err != nil {
+		t.Fatalf("NewCredentialsWithSubject: %v", err)
+	}
+	tok, err := creds.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if got, want := tok.Value, "subject-access-token"; got != want {
+		t.Errorf("token = %q, want %q", got, want)
+	}
+}
+
+func TestNewCredentialsWithSubject_Errors(t *testing.T) {
+	validOpts := &CredentialsOptions{
+		TargetPrincipal: "sa@project.iam.gserviceaccount.com",
+		Scopes:          []string{"https://www.googleapis.com/auth/cloud-platform"},
+	}
+	tests := []struct {
+		name    string
+		opts    *CredentialsOptions
+		subject string
+	}{
+		{name: "nil opts", opts: nil, subject: "user@example.com"},
+		{name: "empty subject", opts: validOpts, subject: ""},
+		{name: "invalid opts", opts: &CredentialsOptions{}, subject: "user@example.com"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewCredentialsWithSubject(tc.opts, tc.subject); err == nil {
+				t.Error("NewCredentialsWithSubject: got nil error, want error")
+			}
+		})
+	}
+}
@@ -17,11 +17,14 @@ package impersonate
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	neturl "net/url"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/auth"
@@ -48,6 +51,20 @@ type IDTokenOptions struct {
 	// roles/iam.serviceAccountTokenCreator on the next service account in the
 	// chain. Optional.
 	Delegates []string
+	// Subject is the email address of a G Suite/Workspace user to impersonate
+	// on behalf of the target service account. TargetPrincipal must have
+	// domain-wide delegation enabled for the Subject's domain, and the
+	// caller's credentials must be authorized to sign JWTs for
+	// TargetPrincipal. When set, the resulting ID token is minted for the
+	// Subject rather than for TargetPrincipal directly. Optional.
+	Subject string
+	// Lifetime is the amount of time until the impersonated token expires.
+	// If unset this defaults to 1 hour. IAM may return a token with a
+	// shorter lifetime than requested, for example under the
+	// constraints/iam.allowServiceAccountCredentialLifetimeExtension org
+	// policy; the actual expiry is always read from the returned token's
+	// `exp` claim when possible. Optional.
+	Lifetime time.Duration
 
 	// Credentials used in generating the impersonated ID token. If empty, an
 	// attempt will be made to detect credentials from the environment (see
@@ -74,6 +91,9 @@ func (o *IDTokenOptions) validate() error {
 	if o.TargetPrincipal == "" {
 		return errors.New("impersonate: target service account must be provided")
 	}
+	if o.Lifetime < 0 || o.Lifetime > maxLifetime {
+		return errors.New("impersonate: lifetime must be positive and at most 12 hours")
+	}
 	return nil
 }
 
@@ -81,11 +101,17 @@ var (
 	defaultScope = "https://www.googleapis.com/auth/cloud-platform"
 )
 
+// googleTokenEndpoint is used to exchange a signed JWT assertion for a
+// Google-issued token in the domain-wide delegation flow.
+var googleTokenEndpoint = "https://oauth2.googleapis.com/token"
+
 // NewIDTokenCredentials creates an impersonated
 // [cloud.google.com/go/auth/Credentials] that returns ID tokens configured
 // with the provided config and using credentials loaded from Application
 // Default Credentials as the base credentials if not provided with the opts.
-// The tokens produced are valid for one hour and are automatically refreshed.
+// The tokens produced are requested for opts.Lifetime, or one hour if unset,
+// and are automatically refreshed. When opts.Subject is set, the signed
+// assertion's lifetime is capped at one hour regardless of opts.Lifetime.
 func NewIDTokenCredentials(opts *IDTokenOptions) (*auth.Credentials, error) {
 	if err := opts.validate(); err != nil {
 		return nil, err
@@ -116,12 +142,19 @@ func NewIDTokenCredentials(opts *IDTokenOptions) (*auth.Credentials, error) {
 		}
 	}
 
+	lifetime := opts.Lifetime
+	if lifetime == 0 {
+		lifetime = defaultLifetime
+	}
 	itp := impersonatedIDTokenProvider{
 		client:          client,
 		targetPrincipal: opts.TargetPrincipal,
 		audience:        opts.Audience,
 		includeEmail:    opts.IncludeEmail,
+		subject:         opts.Subject,
+		lifetime:        lifetime,
 		logger:          logger,
+		nowFunc:         time.Now,
 	}
 	for _, v := range opts.Delegates {
 		itp.delegates = append(itp.delegates, formatIAMServiceAccountName(v))
@@ -137,16 +170,58 @@ func NewIDTokenCredentials(opts *IDTokenOptions) (*auth.Credentials, error) {
 	}), nil
 }
 
+// NewIDTokenCredentialsWithSubject creates an impersonated
+// [cloud.google.com/go/auth/Credentials] that returns ID tokens minted on
+// behalf of subject, a G Suite/Workspace user. This requires that
+// opts.TargetPrincipal has domain-wide delegation enabled for subject's
+// domain by the Workspace administrator, and that the caller's credentials
+// are authorized to sign JWTs for opts.TargetPrincipal (for example by
+// holding roles/iam.serviceAccountTokenCreator). Unlike NewIDTokenCredentials,
+// the returned token is generated by signing a JWT assertion naming subject
+// as the `sub` claim and exchanging it at the Google OAuth2 token endpoint,
+// rather than by calling IAM Credentials generateIdToken directly.
+func NewIDTokenCredentialsWithSubject(opts *IDTokenOptions, subject string) (*auth.Credentials, error) {
+	if opts == nil {
+		return nil, errors.New("impersonate: options must be provided")
+	}
+	if subject == "" {
+		return nil, errors.New("impersonate: subject must be provided")
+	}
+	o := *opts
+	o.Subject = subject
+	return NewIDTokenCredentials(&o)
+}
+
 type generateIDTokenRequest struct {
 	Audience     string   `json:"audience"`
 	IncludeEmail bool     `json:"includeEmail"`
 	Delegates    []string `json:"delegates,omitempty"`
+	Lifetime     string   `json:"lifetime,omitempty"`
 }
 
 type generateIDTokenResponse struct {
 	Token string `json:"token"`
 }
 
+// signJwtRequest is the body sent to IAM Credentials signJwt, used to sign
+// the JWT assertion for the domain-wide delegation flow.
+type signJwtRequest struct {
+	Payload   string   `json:"payload"`
+	Delegates []string `json:"delegates,omitempty"`
+}
+
+type signJwtResponse struct {
+	SignedJwt string `json:"signedJwt"`
+}
+
+// subjectTokenResponse is the OAuth2 token endpoint response to the assertion
+// exchange that turns a signed JWT bearing a `sub` claim into an ID token for
+// that subject.
+type subjectTokenResponse struct {
+	IDToken   string `json:"id_token"`
+	ExpiresIn int64  `json:"expires_in"`
+}
+
 type impersonatedIDTokenProvider struct {
 	client *http.Client
 	logger *slog.Logger
@@ -154,14 +229,25 @@ type impersonatedIDTokenProvider struct {
 	targetPrincipal string
 	audience        string
 	includeEmail    bool
+	subject         string
 	delegates       []string
+	lifetime        time.Duration
+
+	// nowFunc is used in place of time.Now so tests can drive
+	// auth.NewCachedTokenProvider's refresh logic deterministically.
+	nowFunc func() time.Time
 }
 
 func (i impersonatedIDTokenProvider) Token(ctx context.Context) (*auth.Token, error) {
+	if i.subject != "" {
+		return i.subjectToken(ctx)
+	}
+
 	genIDTokenReq := generateIDTokenRequest{
 		Audience:     i.audience,
 		IncludeEmail: i.includeEmail,
 		Delegates:    i.delegates,
+		Lifetime:     fmt.Sprintf("%ds", int(i.lifetime.Seconds())),
 	}
 	bodyBytes, err := json.Marshal(genIDTokenReq)
 	if err != nil {
@@ -189,8 +275,129 @@ func (i impersonatedIDTokenProvider) Token(ctx context.Context) (*auth.Token, er
 		return nil, fmt.Errorf("impersonate: unable to parse response: %w", err)
 	}
 	return &auth.Token{
-		Value: generateIDTokenResp.Token,
-		// Generated ID tokens are good for one hour.
-		Expiry: time.Now().Add(1 * time.Hour),
+		Value:  generateIDTokenResp.Token,
+		Expiry: i.expiry(generateIDTokenResp.Token),
+	}, nil
+}
+
+// expiry returns the `exp` claim parsed from token, falling back to
+// i.nowFunc()+i.lifetime if the token cannot be parsed.
+func (i impersonatedIDTokenProvider) expiry(token string) time.Time {
+	if exp, ok := jwtExpiry(token); ok {
+		return exp
+	}
+	return i.nowFunc().Add(i.lifetime)
+}
+
+// jwtExpiry extracts and parses the `exp` claim from an unverified JWT's
+// payload segment.
+func jwtExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(claims.Exp, 0), true
+}
+
+// subjectToken implements domain-wide delegation: it signs a JWT assertion
+// naming i.subject as the `sub` claim via IAM Credentials signJwt, then
+// exchanges that assertion at the Google OAuth2 token endpoint for an ID
+// token minted on the subject's behalf.
+func (i impersonatedIDTokenProvider) subjectToken(ctx context.Context) (*auth.Token, error) {
+	now := i.nowFunc()
+	claims := map[string]interface{}{
+		"iss":             i.targetPrincipal,
+		"sub":             i.subject,
+		"aud":             googleTokenEndpoint,
+		"target_audience": i.audience,
+		"iat":             now.Unix(),
+		"exp":             now.Add(assertionLifetime(i.lifetime)).Unix(),
+	}
+	tokenBody, err := signAndExchangeJWT(ctx, i.client, i.logger, i.targetPrincipal, i.delegates, claims)
+	if err != nil {
+		return nil, err
+	}
+	var subjectResp subjectTokenResponse
+	if err := json.Unmarshal(tokenBody, &subjectResp); err != nil {
+		return nil, fmt.Errorf("impersonate: unable to parse token response: %w", err)
+	}
+	expiry, ok := jwtExpiry(subjectResp.IDToken)
+	if !ok {
+		expiry = now.Add(time.Duration(subjectResp.ExpiresIn) * time.Second)
+	}
+	return &auth.Token{
+		Value:  subjectResp.IDToken,
+		Expiry: expiry,
 	}, nil
 }
+
+// signAndExchangeJWT signs claims into a JWT assertion via IAM Credentials
+// signJwt, then exchanges that assertion at the Google OAuth2 token endpoint
+// using the jwt-bearer grant type, returning the raw token endpoint response
+// body. Shared by the ID-token and access-token domain-wide delegation
+// flows, which differ only in the claims they sign and how they parse the
+// response.
+func signAndExchangeJWT(ctx context.Context, client *http.Client, logger *slog.Logger, targetPrincipal string, delegates []string, claims map[string]interface{}) ([]byte, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return nil, fmt.Errorf("impersonate: unable to marshal JWT claims: %w", err)
+	}
+
+	signJwtReq := signJwtRequest{
+		Payload:   string(payload),
+		Delegates: delegates,
+	}
+	bodyBytes, err := json.Marshal(signJwtReq)
+	if err != nil {
+		return nil, fmt.Errorf("impersonate: unable to marshal request: %w", err)
+	}
+	url := fmt.Sprintf("%s/v1/%s:signJwt", iamCredentialsEndpoint, formatIAMServiceAccountName(targetPrincipal))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("impersonate: unable to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	logger.DebugContext(ctx, "impersonated signjwt request", "request", internallog.HTTPRequest(req, bodyBytes))
+	resp, body, err := internal.DoRequest(client, req)
+	if err != nil {
+		return nil, fmt.Errorf("impersonate: unable to sign JWT: %w", err)
+	}
+	logger.DebugContext(ctx, "impersonated signjwt response", "response", internallog.HTTPResponse(resp, body))
+	if c := resp.StatusCode; c < 200 || c > 299 {
+		return nil, fmt.Errorf("impersonate: status code %d: %s", c, body)
+	}
+	var signJwtResp signJwtResponse
+	if err := json.Unmarshal(body, &signJwtResp); err != nil {
+		return nil, fmt.Errorf("impersonate: unable to parse signJwt response: %w", err)
+	}
+
+	form := neturl.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {signJwtResp.SignedJwt},
+	}
+	tokenReq, err := http.NewRequestWithContext(ctx, "POST", googleTokenEndpoint, bytes.NewReader([]byte(form.Encode())))
+	if err != nil {
+		return nil, fmt.Errorf("impersonate: unable to create request: %w", err)
+	}
+	tokenReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	logger.DebugContext(ctx, "impersonated subject token request", "request", internallog.HTTPRequest(tokenReq, []byte(form.Encode())))
+	tokenResp, tokenBody, err := internal.DoRequest(client, tokenReq)
+	if err != nil {
+		return nil, fmt.Errorf("impersonate: unable to exchange JWT assertion: %w", err)
+	}
+	logger.DebugContext(ctx, "impersonated subject token response", "response", internallog.HTTPResponse(tokenResp, tokenBody))
+	if c := tokenResp.StatusCode; c < 200 || c > 299 {
+		return nil, fmt.Errorf("impersonate: status code %d: %s", c, tokenBody)
+	}
+	return tokenBody, nil
+}
@@ -0,0 +1,287 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package impersonate
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newSignJwtAndTokenServer returns a server that handles both the IAM
+// Credentials signJwt call and the OAuth2 token endpoint exchange used by
+// the domain-wide delegation flow, dispatching on path suffix.
+func newSignJwtAndTokenServer(t *testing.T, signedJwt, respBody string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, ":signJwt") {
+			w.Write([]byte(`{"signedJwt":"` + signedJwt + `"}`))
+			return
+		}
+		w.Write([]byte(respBody))
+	}))
+}
+
+// fakeJWT builds a token with the given `exp` claim but no real signature,
+// sufficient for exercising jwtExpiry's unverified payload parsing.
+func fakeJWT(t *testing.T, exp int64) string {
+	t.Helper()
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, exp)))
+	return "header." + payload + ".signature"
+}
+
+func TestNewIDTokenCredentials(t *testing.T) {
+	wantExp := time.Now().Add(30 * time.Minute).Truncate(time.Second)
+	token := fakeJWT(t, wantExp.Unix())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"token":"` + token + `"}`))
+	}))
+	defer srv.Close()
+	origIAM := iamCredentialsEndpoint
+	iamCredentialsEndpoint = srv.URL
+	defer func() { iamCredentialsEndpoint = origIAM }()
+
+	creds, err := NewIDTokenCredentials(&IDTokenOptions{
+		Audience:        "https://example.com",
+		TargetPrincipal: "sa@project.iam.gserviceaccount.com",
+		Client:          http.DefaultClient,
+	})
+	if err != nil {
+		t.Fatalf("NewIDTokenCredentials: %v", err)
+	}
+	tok, err := creds.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if got, want := tok.Value, token; got != want {
+		t.Errorf("token = %q, want %q", got, want)
+	}
+	if !tok.Expiry.Equal(wantExp) {
+		t.Errorf("expiry = %v, want %v", tok.Expiry, wantExp)
+	}
+}
+
+func TestNewIDTokenCredentials_IAMError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"error":"permission denied"}`))
+	}))
+	defer srv.Close()
+	origIAM := iamCredentialsEndpoint
+	iamCredentialsEndpoint = srv.URL
+	defer func() { iamCredentialsEndpoint = origIAM }()
+
+	creds, err := NewIDTokenCredentials(&IDTokenOptions{
+		Audience:        "https://example.com",
+		TargetPrincipal: "sa@project.iam.gserviceaccount.com",
+		Client:          http.DefaultClient,
+	})
+	if err != nil {
+		t.Fatalf("NewIDTokenCredentials: %v", err)
+	}
+	if _, err := creds.Token(context.Background()); err == nil {
+		t.Error("Token: got nil error, want error from IAM Credentials")
+	}
+}
+
+func TestIDTokenOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    *IDTokenOptions
+		wantErr bool
+	}{
+		{name: "nil", opts: nil, wantErr: true},
+		{
+			name:    "missing audience",
+			opts:    &IDTokenOptions{TargetPrincipal: "sa@project.iam.gserviceaccount.com"},
+			wantErr: true,
+		},
+		{
+			name:    "missing target principal",
+			opts:    &IDTokenOptions{Audience: "https://example.com"},
+			wantErr: true,
+		},
+		{
+			name: "negative lifetime",
+			opts: &IDTokenOptions{
+				Audience:        "https://example.com",
+				TargetPrincipal: "sa@project.iam.gserviceaccount.com",
+				Lifetime:        -1 * time.Second,
+			},
+			wantErr: true,
+		},
+		{
+			name: "lifetime exceeds max",
+			opts: &IDTokenOptions{
+				Audience:        "https://example.com",
+				TargetPrincipal: "sa@project.iam.gserviceaccount.com",
+				Lifetime:        13 * time.Hour,
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid",
+			opts: &IDTokenOptions{
+				Audience:        "https://example.com",
+				TargetPrincipal: "sa@project.iam.gserviceaccount.com",
+			},
+			wantErr: false,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.opts.validate()
+			if (err != nil) != tc.wantErr {
+				t.Errorf("validate() = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestJwtExpiry(t *testing.T) {
+	want := time.Unix(1893456000, 0)
+	token := fakeJWT(t, want.Unix())
+	got, ok := jwtExpiry(token)
+	if !ok {
+		t.Fatalf("jwtExpiry(%q): ok = false, want true", token)
+	}
+	if !got.Equal(want) {
+		t.Errorf("jwtExpiry(%q) = %v, want %v", token, got, want)
+	}
+}
+
+func TestJwtExpiry_Malformed(t *testing.T) {
+	tests := []string{"", "not-a-jwt", "a.b", "a.b.c.d"}
+	for _, tok := range tests {
+		if _, ok := jwtExpiry(tok); ok {
+			t.Errorf("jwtExpiry(%q): ok = true, want false", tok)
+		}
+	}
+}
+
+func TestImpersonatedIDTokenProviderExpiry_FallsBackOnMalformedToken(t *testing.T) {
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	itp := impersonatedIDTokenProvider{
+		lifetime: time.Hour,
+		nowFunc:  func() time.Time { return now },
+	}
+	want := now.Add(time.Hour)
+	if got := itp.expiry("not-a-jwt"); !got.Equal(want) {
+		t.Errorf("expiry(\"not-a-jwt\") = %v, want %v", got, want)
+	}
+}
+
+func TestNewIDTokenCredentialsWithSubject(t *testing.T) {
+	srv := newSignJwtAndTokenServer(t, "fake.signed.jwt", `{"id_token":"subject-id-token","expires_in":3600}`)
+	defer srv.Close()
+	origIAM, origToken := iamCredentialsEndpoint, googleTokenEndpoint
+	iamCredentialsEndpoint, googleTokenEndpoint = srv.URL, srv.URL
+	defer func() { iamCredentialsEndpoint, googleTokenEndpoint = origIAM, origToken }()
+
+	creds, err := NewIDTokenCredentialsWithSubject(&IDTokenOptions{
+		Audience:        "https://example.com",
+		TargetPrincipal: "sa@project.iam.gserviceaccount.com",
+		Client:          http.DefaultClient,
+	}, "user@example.com")
+	if err != nil {
+		t.Fatalf("NewIDTokenCredentialsWithSubject: %v", err)
+	}
+	tok, err := creds.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if got, want := tok.Value, "subject-id-token"; got != want {
+		t.Errorf("token = %q, want %q", got, want)
+	}
+}
+
+func TestNewIDTokenCredentialsWithSubject_CapsAssertionLifetime(t *testing.T) {
+	var signJwtBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, ":signJwt") {
+			signJwtBody, _ = io.ReadAll(r.Body)
+			w.Write([]byte(`{"signedJwt":"fake.signed.jwt"}`))
+			return
+		}
+		w.Write([]byte(`{"id_token":"subject-id-token","expires_in":3600}`))
+	}))
+	defer srv.Close()
+	origIAM, origToken := iamCredentialsEndpoint, googleTokenEndpoint
+	iamCredentialsEndpoint, googleTokenEndpoint = srv.URL, srv.URL
+	defer func() { iamCredentialsEndpoint, googleTokenEndpoint = origIAM, origToken }()
+
+	creds, err := NewIDTokenCredentialsWithSubject(&IDTokenOptions{
+		Audience:        "https://example.com",
+		TargetPrincipal: "sa@project.iam.gserviceaccount.com",
+		Lifetime:        2 * time.Hour,
+		Client:          http.DefaultClient,
+	}, "user@example.com")
+	if err != nil {
+		t.Fatalf("NewIDTokenCredentialsWithSubject: %v", err)
+	}
+	if _, err := creds.Token(context.Background()); err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+
+	var signJwtReq struct {
+		Payload string `json:"payload"`
+	}
+	if err := json.Unmarshal(signJwtBody, &signJwtReq); err != nil {
+		t.Fatalf("unmarshal signJwt request: %v", err)
+	}
+	var claims struct {
+		Iat int64 `json:"iat"`
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal([]byte(signJwtReq.Payload), &claims); err != nil {
+		t.Fatalf("unmarshal assertion claims: %v", err)
+	}
+	if span := claims.Exp - claims.Iat; span > int64(jwtBearerMaxLifetime.Seconds()) {
+		t.Errorf("assertion exp-iat = %ds, want at most %ds (Lifetime of 2h must not bypass Google's JWT-bearer max lifetime)", span, int64(jwtBearerMaxLifetime.Seconds()))
+	}
+}
+
+func TestNewIDTokenCredentialsWithSubject_Errors(t *testing.T) {
+	validOpts := &IDTokenOptions{
+		Audience:        "https://example.com",
+		TargetPrincipal: "sa@project.iam.gserviceaccount.com",
+	}
+	tests := []struct {
+		name    string
+		opts    *IDTokenOptions
+		subject string
+	}{
+		{name: "nil opts", opts: nil, subject: "user@example.com"},
+		{name: "empty subject", opts: validOpts, subject: ""},
+		{name: "invalid opts", opts: &IDTokenOptions{}, subject: "user@example.com"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewIDTokenCredentialsWithSubject(tc.opts, tc.subject); err == nil {
+				t.Error("NewIDTokenCredentialsWithSubject: got nil error, want error")
+			}
+		})
+	}
+}